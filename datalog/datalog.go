@@ -28,6 +28,39 @@ type Symbol uint64
 
 func (Symbol) Type() IDType { return IDTypeSymbol }
 
+// SymbolTable interns symbol names to Symbol ids and back, so a
+// human-readable identifier such as "read" or "resource" is only ever
+// written once instead of being repeated in every predicate that uses it.
+type SymbolTable []string
+
+// Insert returns the Symbol for s, adding it to the table if it isn't
+// already present.
+func (t *SymbolTable) Insert(s string) Symbol {
+	if sym, ok := t.Sym(s); ok {
+		return sym
+	}
+	*t = append(*t, s)
+	return Symbol(len(*t) - 1)
+}
+
+// Sym looks up the Symbol for s without modifying the table.
+func (t *SymbolTable) Sym(s string) (Symbol, bool) {
+	for i, existing := range *t {
+		if existing == s {
+			return Symbol(i), true
+		}
+	}
+	return 0, false
+}
+
+// Str resolves sym back to its interned name.
+func (t *SymbolTable) Str(sym Symbol) (string, bool) {
+	if int(sym) >= len(*t) {
+		return "", false
+	}
+	return (*t)[sym], true
+}
+
 type Variable uint32
 
 func (Variable) Type() IDType { return IDTypeVariable }
@@ -102,9 +135,18 @@ const (
 	StringComparisonSuffix
 )
 
+// StringComparisonMatcher's comparison string is named Str, not String, so
+// that the type can implement fmt.Stringer without a field/method name
+// clash.
+//
+// BREAKING CHANGE: this field was previously named String; any caller
+// constructing a StringComparisonMatcher with a String: field (struct
+// literal) needs to update it to Str. There is no deprecated alias, since
+// Go doesn't allow the field and the new String() method to coexist under
+// either name.
 type StringComparisonMatcher struct {
 	Comparison StringComparison
-	String     String
+	Str        String
 }
 
 func (m *StringComparisonMatcher) Match(id ID) bool {
@@ -114,11 +156,11 @@ func (m *StringComparisonMatcher) Match(id ID) bool {
 	}
 	switch m.Comparison {
 	case StringComparisonEqual:
-		return m.String == v
+		return m.Str == v
 	case StringComparisonPrefix:
-		return strings.HasPrefix(string(v), string(m.String))
+		return strings.HasPrefix(string(v), string(m.Str))
 	case StringComparisonSuffix:
-		return strings.HasSuffix(string(v), string(m.String))
+		return strings.HasSuffix(string(v), string(m.Str))
 	default:
 		return false
 	}
@@ -265,7 +307,233 @@ type InvalidRuleError struct {
 }
 
 func (e InvalidRuleError) Error() string {
-	return fmt.Sprintf("datalog: variable %d in head is missing from body and/or constraints")
+	return fmt.Sprintf("datalog: variable %d in head is missing from body and/or constraints", e.MissingVariable)
+}
+
+// RuleDiagnosticKind identifies which validation rule a RuleDiagnostic
+// reports a violation of.
+type RuleDiagnosticKind byte
+
+const (
+	// DiagnosticHeadVariableNotInBody: a head variable never appears in the
+	// body, so it can never be bound; naming it in a constraint does not
+	// bind it.
+	DiagnosticHeadVariableNotInBody RuleDiagnosticKind = iota
+	// DiagnosticConstraintVariableNotInBody: a constraint names a variable
+	// that never appears in the body, so it can never run.
+	DiagnosticConstraintVariableNotInBody
+	// DiagnosticUnusedBodyVariable: a body variable appears exactly once and
+	// is never referenced by the head or a constraint, so it only wastes a
+	// unification slot.
+	DiagnosticUnusedBodyVariable
+	// DiagnosticDuplicateConstraint: the same constraint is attached to a
+	// variable more than once.
+	DiagnosticDuplicateConstraint
+	// DiagnosticConstraintTypeMismatch: a variable is constrained by
+	// matchers that expect mutually exclusive ID types, so no fact can ever
+	// satisfy all of them at once.
+	DiagnosticConstraintTypeMismatch
+)
+
+// RuleDiagnostic describes a single problem found while validating a Rule.
+type RuleDiagnostic struct {
+	Kind     RuleDiagnosticKind
+	Variable Variable
+	Message  string
+}
+
+func (d RuleDiagnostic) Error() string { return d.Message }
+
+// RuleValidationError reports every problem found while validating a Rule,
+// rather than stopping at the first one.
+type RuleValidationError struct {
+	Rule        Rule
+	Diagnostics []RuleDiagnostic
+}
+
+func (e *RuleValidationError) Error() string {
+	msgs := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		msgs[i] = d.Message
+	}
+	return fmt.Sprintf("datalog: invalid rule: %s", strings.Join(msgs, "; "))
+}
+
+// matchersEqual reports whether a and b are equivalent constraints, by
+// comparing their concrete fields rather than delegating to whatever
+// String() a matcher happens to have, so that equality never depends on how
+// a matcher is rendered. A StringGlobMatcher is compared by the pattern it
+// was compiled from.
+func matchersEqual(a, b Matcher) bool {
+	switch av := a.(type) {
+	case *IntegerComparisonMatcher:
+		bv, ok := b.(*IntegerComparisonMatcher)
+		return ok && *av == *bv
+	case *IntegerInMatcher:
+		bv, ok := b.(*IntegerInMatcher)
+		if !ok || av.Not != bv.Not || len(av.Set) != len(bv.Set) {
+			return false
+		}
+		for i := range av.Set {
+			if _, found := bv.Set[i]; !found {
+				return false
+			}
+		}
+		return true
+	case *StringComparisonMatcher:
+		bv, ok := b.(*StringComparisonMatcher)
+		return ok && *av == *bv
+	case *StringInMatcher:
+		bv, ok := b.(*StringInMatcher)
+		if !ok || av.Not != bv.Not || len(av.Set) != len(bv.Set) {
+			return false
+		}
+		for s := range av.Set {
+			if _, found := bv.Set[s]; !found {
+				return false
+			}
+		}
+		return true
+	case *StringRegexpMatcher:
+		bv, ok := b.(*StringRegexpMatcher)
+		return ok && (*regexp.Regexp)(av).String() == (*regexp.Regexp)(bv).String()
+	case *StringGlobMatcher:
+		bv, ok := b.(*StringGlobMatcher)
+		return ok && av.pattern == bv.pattern
+	case *DateComparisonMatcher:
+		bv, ok := b.(*DateComparisonMatcher)
+		return ok && *av == *bv
+	case *SymbolInMatcher:
+		bv, ok := b.(*SymbolInMatcher)
+		if !ok || av.Not != bv.Not || len(av.Set) != len(bv.Set) {
+			return false
+		}
+		for s := range av.Set {
+			if _, found := bv.Set[s]; !found {
+				return false
+			}
+		}
+		return true
+	case InvalidMatcher:
+		_, ok := b.(InvalidMatcher)
+		return ok
+	default:
+		return false
+	}
+}
+
+// matcherExpectedType returns the IDType a Matcher can ever match, when that
+// can be determined from its concrete implementation. It is used to catch,
+// for example, a DateComparisonMatcher stacked onto a variable that another
+// constraint already restricts to IDTypeInteger: since an ID has exactly
+// one Type(), such a variable could never match any fact.
+func matcherExpectedType(m Matcher) (IDType, bool) {
+	switch m.(type) {
+	case *IntegerComparisonMatcher, *IntegerInMatcher:
+		return IDTypeInteger, true
+	case *StringComparisonMatcher, *StringInMatcher, *StringRegexpMatcher, *StringGlobMatcher:
+		return IDTypeString, true
+	case *DateComparisonMatcher:
+		return IDTypeDate, true
+	case *SymbolInMatcher:
+		return IDTypeSymbol, true
+	default:
+		return 0, false
+	}
+}
+
+// Validate walks r and reports every problem it can find without evaluating
+// it against any facts: head variables absent from the body, constraints
+// referring to variables that never appear in the body, body variables that
+// are never used by the head or a constraint, duplicate constraints, and
+// constraints whose matchers expect incompatible types for the same
+// variable. Callers that build rules from an external representation
+// (parsers, the textformat frontend, biscuit builders) should call this
+// up-front instead of letting Apply fail later with an InvalidRuleError.
+func (r Rule) Validate() error {
+	bodyVars := make(map[Variable]int)
+	for _, p := range r.Body {
+		for _, id := range p.IDs {
+			if v, ok := id.(Variable); ok {
+				bodyVars[v]++
+			}
+		}
+	}
+
+	headVars := make(map[Variable]bool)
+	var diags []RuleDiagnostic
+	for _, id := range r.Head.IDs {
+		v, ok := id.(Variable)
+		if !ok {
+			continue
+		}
+		headVars[v] = true
+		if _, found := bodyVars[v]; !found {
+			diags = append(diags, RuleDiagnostic{
+				Kind:     DiagnosticHeadVariableNotInBody,
+				Variable: v,
+				Message:  fmt.Sprintf("variable %d in head is missing from body and/or constraints", v),
+			})
+		}
+	}
+
+	constrainedVars := make(map[Variable]bool)
+	seenConstraints := make(map[Variable][]Matcher)
+	varTypes := make(map[Variable]map[IDType]bool)
+	for _, c := range r.Constraints {
+		constrainedVars[c.Name] = true
+		if _, found := bodyVars[c.Name]; !found {
+			diags = append(diags, RuleDiagnostic{
+				Kind:     DiagnosticConstraintVariableNotInBody,
+				Variable: c.Name,
+				Message:  fmt.Sprintf("constraint on variable %d refers to a variable absent from the body", c.Name),
+			})
+		}
+
+		for _, seen := range seenConstraints[c.Name] {
+			if matchersEqual(seen, c.Matcher) {
+				diags = append(diags, RuleDiagnostic{
+					Kind:     DiagnosticDuplicateConstraint,
+					Variable: c.Name,
+					Message:  fmt.Sprintf("duplicate constraint on variable %d", c.Name),
+				})
+				break
+			}
+		}
+		seenConstraints[c.Name] = append(seenConstraints[c.Name], c.Matcher)
+
+		if t, ok := matcherExpectedType(c.Matcher); ok {
+			if varTypes[c.Name] == nil {
+				varTypes[c.Name] = make(map[IDType]bool)
+			}
+			varTypes[c.Name][t] = true
+		}
+	}
+
+	for v, types := range varTypes {
+		if len(types) > 1 {
+			diags = append(diags, RuleDiagnostic{
+				Kind:     DiagnosticConstraintTypeMismatch,
+				Variable: v,
+				Message:  fmt.Sprintf("variable %d is constrained by matchers expecting incompatible types and can never match any fact", v),
+			})
+		}
+	}
+
+	for v, count := range bodyVars {
+		if count == 1 && !constrainedVars[v] && !headVars[v] {
+			diags = append(diags, RuleDiagnostic{
+				Kind:     DiagnosticUnusedBodyVariable,
+				Variable: v,
+				Message:  fmt.Sprintf("variable %d appears only once in the body and is never used in the head or a constraint", v),
+			})
+		}
+	}
+
+	if len(diags) == 0 {
+		return nil
+	}
+	return &RuleValidationError{Rule: r, Diagnostics: diags}
 }
 
 func (r Rule) Apply(facts *FactSet, newFacts *FactSet) error {
@@ -280,7 +548,57 @@ func (r Rule) Apply(facts *FactSet, newFacts *FactSet) error {
 		}
 	}
 
-	for _, h := range NewCombinator(variables, r.Body, r.Constraints, facts).Combine() {
+	sources := make([]*FactSet, len(r.Body))
+	for i := range sources {
+		sources[i] = facts
+	}
+
+	return r.applyCombinator(NewCombinator(variables, r.Body, r.Constraints, sources), newFacts)
+}
+
+// ApplyDelta evaluates r using semi-naive evaluation: a combination is only
+// considered if it binds at least one body predicate against a fact in
+// delta, the set of facts newly derived in the previous iteration of
+// World.Run. For each body position i it matches delta against position i,
+// old (facts known before delta was derived) against positions before i,
+// and all (old and delta combined) against positions after i; every
+// combination touching delta is produced exactly once this way, so rounds
+// made up entirely of already-known facts are never redone.
+func (r Rule) ApplyDelta(old, delta, all *FactSet, newFacts *FactSet) error {
+	variables := make(MatchedVariables)
+	for _, p := range r.Body {
+		for _, id := range p.IDs {
+			v, ok := id.(Variable)
+			if !ok {
+				continue
+			}
+			variables[v] = nil
+		}
+	}
+
+	n := len(r.Body)
+	for i := 0; i < n; i++ {
+		sources := make([]*FactSet, n)
+		for j := 0; j < n; j++ {
+			switch {
+			case j < i:
+				sources[j] = old
+			case j == i:
+				sources[j] = delta
+			default:
+				sources[j] = all
+			}
+		}
+		if err := r.applyCombinator(NewCombinator(variables.Clone(), r.Body, r.Constraints, sources), newFacts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r Rule) applyCombinator(c *Combinator, newFacts *FactSet) error {
+	for _, h := range c.Combine() {
 		p := r.Head.Clone()
 		for i, id := range p.IDs {
 			k, ok := id.(Variable)
@@ -295,7 +613,6 @@ func (r Rule) Apply(facts *FactSet, newFacts *FactSet) error {
 		}
 		newFacts.Insert(Fact{p})
 	}
-
 	return nil
 }
 
@@ -303,27 +620,64 @@ type Caveat struct {
 	Queries []Rule
 }
 
-type FactSet []Fact
+// FactSet holds a deduplicated collection of facts, indexed by predicate
+// name so that rule evaluation and queries can look up the facts for a
+// given predicate without scanning the whole set.
+type FactSet struct {
+	facts []Fact
+	index map[Symbol][]Fact
+}
+
+func (s *FactSet) Facts() []Fact {
+	return s.facts
+}
+
+func (s *FactSet) Len() int {
+	return len(s.facts)
+}
 
 func (s *FactSet) Insert(f Fact) bool {
-	for _, v := range *s {
+	for _, v := range s.facts {
 		if v.Equal(f.Predicate) {
 			return false
 		}
 	}
-	*s = append(*s, f)
+	s.facts = append(s.facts, f)
+	if s.index == nil {
+		s.index = make(map[Symbol][]Fact)
+	}
+	s.index[f.Predicate.Name] = append(s.index[f.Predicate.Name], f)
 	return true
 }
 
-func (s *FactSet) InsertAll(facts []Fact) {
+// InsertAll inserts facts into s, skipping any already present, and returns
+// the subset that was actually newly inserted.
+func (s *FactSet) InsertAll(facts []Fact) []Fact {
+	var inserted []Fact
 	for _, f := range facts {
-		s.Insert(f)
+		if s.Insert(f) {
+			inserted = append(inserted, f)
+		}
 	}
+	return inserted
+}
+
+// ByPredicateName returns the facts whose predicate name is name, using the
+// per-name index instead of scanning every fact in s.
+func (s *FactSet) ByPredicateName(name Symbol) []Fact {
+	return s.index[name]
 }
 
 type World struct {
 	facts *FactSet
 	rules []Rule
+
+	// stale holds every fact that was already part of facts the last time
+	// Run reached a fixpoint (nil before the first call). Run diffs facts
+	// against stale at the start of each call to recompute its delta, so a
+	// fact added via AddFact between two Run calls is treated as new
+	// instead of being silently invisible to every rule.
+	stale *FactSet
 }
 
 func (w *World) AddFact(f Fact) {
@@ -334,44 +688,74 @@ func (w *World) AddRule(r Rule) {
 	w.rules = append(w.rules, r)
 }
 
+// Run evaluates the world's rules to a fixpoint using semi-naive
+// evaluation: each iteration only considers combinations that bind at
+// least one body predicate against a fact derived in the previous
+// iteration, rather than re-applying every rule against every fact. Run
+// can be called again on the same World after further AddFact calls: it
+// recomputes its delta as whatever is in facts but wasn't already folded
+// into a previous fixpoint, so newly added facts are never dropped.
 func (w *World) Run() error {
+	if w.stale == nil {
+		w.stale = &FactSet{}
+	}
+
+	old := &FactSet{}
+	old.InsertAll(w.stale.Facts())
+
+	seen := &FactSet{}
+	seen.InsertAll(w.stale.Facts())
+	delta := &FactSet{}
+	for _, f := range w.facts.Facts() {
+		if seen.Insert(f) {
+			delta.Insert(f)
+		}
+	}
+
 	for i := 0; i < 100; i++ {
+		if delta.Len() == 0 {
+			w.stale = &FactSet{}
+			w.stale.InsertAll(w.facts.Facts())
+			return nil
+		}
+
 		var newFacts FactSet
 		for _, r := range w.rules {
-			if err := r.Apply(r.facts, &newFacts); err != nil {
+			if err := r.ApplyDelta(old, delta, w.facts, &newFacts); err != nil {
 				return err
 			}
 		}
-		l := len(newFacts)
-		w.facts.InsertAll([]Fact(newFacts))
-		if len(w.facts) == l {
-			return nil
-		}
+
+		old.InsertAll(delta.Facts())
+		fresh := w.facts.InsertAll(newFacts.Facts())
+		next := &FactSet{}
+		next.InsertAll(fresh)
+		delta = next
 	}
 	return fmt.Errorf("datalog: world ran more than 100 iterations")
 }
 
 func (w *World) Query(pred Predicate) *FactSet {
 	res := &FactSet{}
-	for _, f := range *w.facts {
-		if f.Predicate.Name != pred.Name {
-			continue
-		}
+	for _, f := range w.facts.ByPredicateName(pred.Name) {
 		minLen := len(f.Predicate.IDs)
 		if l := len(pred.IDs); l < minLen {
 			minLen = l
 		}
+		match := true
 		for i := 0; i < minLen; i++ {
 			fID := f.Predicate.IDs[i]
 			pID := pred.IDs[i]
-			if fID.Type() != IDTypeVariable && fid.Type() == pid.Type() {
-				if fID != pID {
-					continue
-				}
-			} else if fID.Type() != IDTypeSymbol && pID.Type() != IDTypeVariable {
+			if pID.Type() == IDTypeVariable {
 				continue
 			}
-			*res = append(*res, f)
+			if fID != pID {
+				match = false
+				break
+			}
+		}
+		if match {
+			res.Insert(f)
 		}
 	}
 	return res
@@ -419,28 +803,33 @@ func (m MatchedVariables) Clone() MatchedVariables {
 	return res
 }
 
+// Combinator enumerates the variable bindings that satisfy a rule body.
+// sources[i] is the FactSet that predicates[i] is matched against, which is
+// what lets Rule.ApplyDelta restrict a single body position to delta facts
+// while the positions before it draw from the old facts and the positions
+// after it from the full fact base.
 type Combinator struct {
 	variables    MatchedVariables
 	predicates   []Predicate
 	constraints  []Constraint
-	allFacts     *FactSet
-	currentFacts *FactSet
+	sources      []*FactSet
+	currentFacts []Fact
 }
 
-func NewCombinator(variables MatchedVariables, predicates []Predicate, constraints []Constraint, allFacts *FactSet) *Combinator {
+func NewCombinator(variables MatchedVariables, predicates []Predicate, constraints []Constraint, sources []*FactSet) *Combinator {
 	c := &Combinator{
 		variables:   variables,
 		predicates:  predicates,
 		constraints: constraints,
-		allFacts:    allFacts,
+		sources:     sources,
 	}
-	currentFacts := make(FactSet, 0, len(*allFacts))
-	for _, f := range *allFacts {
+	var currentFacts []Fact
+	for _, f := range sources[0].ByPredicateName(predicates[0].Name) {
 		if f.Match(predicates[0]) {
 			currentFacts = append(currentFacts, f)
 		}
 	}
-	c.currentFacts = &currentFacts
+	c.currentFacts = currentFacts
 	return c
 }
 
@@ -452,52 +841,47 @@ func (c *Combinator) Combine() []map[Variable]*ID {
 		}
 		return variables
 	}
-	if len(*c.currentFacts) == 0 {
-		return variables
-	}
 
-	for i, pred := range c.predicates {
-		for _, currentFact := range *c.currentFacts {
-			vars := c.variables.Clone()
-			matchIDs := true
-			minLen := len(pred.IDs)
-			if l := len(currentFact.Predicate.IDs); l < minLen {
-				minLen = l
-			}
+	pred := c.predicates[0]
+	for _, currentFact := range c.currentFacts {
+		vars := c.variables.Clone()
+		matchIDs := true
+		minLen := len(pred.IDs)
+		if l := len(currentFact.Predicate.IDs); l < minLen {
+			minLen = l
+		}
 
-			for j := 0; j < minLen; j++ {
-				id := pred.IDs[j]
-				k, ok := id.(Variable)
-				if !ok {
-					continue
-				}
-				v := currentFact.Predicate.IDs[j]
-				for _, con := range c.constraints {
-					if !con.Check(k, v) {
-						matchIDs = false
-						break
-					}
-				}
-				if !vars.Insert(k, v) {
+		for j := 0; j < minLen; j++ {
+			id := pred.IDs[j]
+			k, ok := id.(Variable)
+			if !ok {
+				continue
+			}
+			v := currentFact.Predicate.IDs[j]
+			for _, con := range c.constraints {
+				if !con.Check(k, v) {
 					matchIDs = false
-				}
-				if !matchIDs {
 					break
 				}
 			}
-
 			if !matchIDs {
-				continue
+				break
 			}
-
-			if len(c.predicates) > i+1 {
-				variables = append(variables, NewCombinator(vars, c.predicates[i+1:], c.constraints, c.allFacts).Combine()...)
-			} else {
-				if v := vars.Complete(); v != nil {
-					variables = append(variables, v)
-				}
+			if !vars.Insert(k, v) {
+				matchIDs = false
+				break
 			}
 		}
+
+		if !matchIDs {
+			continue
+		}
+
+		if len(c.predicates) > 1 {
+			variables = append(variables, NewCombinator(vars, c.predicates[1:], c.constraints, c.sources[1:]).Combine()...)
+		} else if v := vars.Complete(); v != nil {
+			variables = append(variables, v)
+		}
 	}
 	return variables
 }
\ No newline at end of file
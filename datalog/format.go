@@ -0,0 +1,226 @@
+package datalog
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This file implements fmt.Stringer on every datalog value and Matcher, and
+// a Format variant that resolves Symbol ids through a SymbolTable, so that
+// rules, facts and caveats can be logged or diffed in the canonical biscuit
+// datalog surface syntax instead of via reflect.DeepEqual and hand-formatted
+// output, e.g.:
+//
+//	right(#authority, $0, #read) <- resource(#ambient, $0), operation(#ambient, #read)
+
+func (v Variable) String() string { return fmt.Sprintf("$%d", uint32(v)) }
+
+func (i Integer) String() string { return strconv.FormatInt(int64(i), 10) }
+
+func (s String) String() string { return strconv.Quote(string(s)) }
+
+func (d Date) String() string { return time.Unix(int64(d), 0).UTC().Format(time.RFC3339) }
+
+// String renders the Symbol as its raw numeric id; use Format with a
+// SymbolTable to render its interned name instead.
+func (s Symbol) String() string { return fmt.Sprintf("#<%d>", uint64(s)) }
+
+// Format renders the Symbol as #name when syms resolves it, falling back to
+// String otherwise.
+func (s Symbol) Format(syms *SymbolTable) string {
+	if syms != nil {
+		if name, ok := syms.Str(s); ok {
+			return "#" + name
+		}
+	}
+	return s.String()
+}
+
+func formatID(id ID, syms *SymbolTable) string {
+	if s, ok := id.(Symbol); ok {
+		return s.Format(syms)
+	}
+	return fmt.Sprint(id)
+}
+
+func (p Predicate) String() string { return p.Format(nil) }
+
+// Format renders p as name(id, id, ...), e.g. resource(#ambient, $0),
+// resolving Symbol ids through syms.
+func (p Predicate) Format(syms *SymbolTable) string {
+	name := p.Name.Format(syms)[1:] // predicate names are never printed with the leading '#'
+	ids := make([]string, len(p.IDs))
+	for i, id := range p.IDs {
+		ids[i] = formatID(id, syms)
+	}
+	return fmt.Sprintf("%s(%s)", name, strings.Join(ids, ", "))
+}
+
+func (c Constraint) String() string { return c.Format(nil) }
+
+// Format renders c as "$name matcher", e.g. $0 matches /ab.*/.
+func (c Constraint) Format(syms *SymbolTable) string {
+	return fmt.Sprintf("%s %s", Variable(c.Name), matcherFormat(c.Matcher, syms))
+}
+
+func matcherFormat(m Matcher, syms *SymbolTable) string {
+	if f, ok := m.(interface {
+		Format(*SymbolTable) string
+	}); ok {
+		return f.Format(syms)
+	}
+	return fmt.Sprint(m)
+}
+
+func (c IntegerComparison) symbol() string {
+	switch c {
+	case IntegerComparisonEqual:
+		return "=="
+	case IntegerComparisonLT:
+		return "<"
+	case IntegerComparisonGT:
+		return ">"
+	case IntegerComparisonLTE:
+		return "<="
+	case IntegerComparisonGTE:
+		return ">="
+	default:
+		return "?"
+	}
+}
+
+func (m *IntegerComparisonMatcher) String() string {
+	return fmt.Sprintf("%s %s", m.Comparison.symbol(), m.Integer)
+}
+
+func (m *IntegerInMatcher) String() string {
+	ints := make([]string, 0, len(m.Set))
+	for i := range m.Set {
+		ints = append(ints, i.String())
+	}
+	sort.Strings(ints)
+	op := "in"
+	if m.Not {
+		op = "not in"
+	}
+	return fmt.Sprintf("%s [%s]", op, strings.Join(ints, ", "))
+}
+
+func (c StringComparison) symbol() string {
+	switch c {
+	case StringComparisonEqual:
+		return "=="
+	case StringComparisonPrefix:
+		return "starts with"
+	case StringComparisonSuffix:
+		return "ends with"
+	default:
+		return "?"
+	}
+}
+
+func (m *StringComparisonMatcher) String() string {
+	return fmt.Sprintf("%s %s", m.Comparison.symbol(), m.Str)
+}
+
+func (m *StringInMatcher) String() string {
+	strs := make([]string, 0, len(m.Set))
+	for s := range m.Set {
+		strs = append(strs, s.String())
+	}
+	sort.Strings(strs)
+	op := "in"
+	if m.Not {
+		op = "not in"
+	}
+	return fmt.Sprintf("%s [%s]", op, strings.Join(strs, ", "))
+}
+
+func (m *StringRegexpMatcher) String() string {
+	return fmt.Sprintf("matches /%s/", (*regexp.Regexp)(m).String())
+}
+
+func (m *StringGlobMatcher) String() string {
+	return fmt.Sprintf("matches %s", m.pattern)
+}
+
+func (c DateComparison) symbol() string {
+	switch c {
+	case DateComparisonBefore:
+		return "<="
+	case DateComparisonAfter:
+		return ">="
+	default:
+		return "?"
+	}
+}
+
+func (m *DateComparisonMatcher) String() string {
+	return fmt.Sprintf("%s %s", m.Comparison.symbol(), m.Date)
+}
+
+func (m *SymbolInMatcher) String() string { return m.Format(nil) }
+
+// Format renders the matched symbol set, resolving each Symbol through syms.
+func (m *SymbolInMatcher) Format(syms *SymbolTable) string {
+	syms2 := make([]string, 0, len(m.Set))
+	for s := range m.Set {
+		syms2 = append(syms2, s.Format(syms))
+	}
+	sort.Strings(syms2)
+	op := "in"
+	if m.Not {
+		op = "not in"
+	}
+	return fmt.Sprintf("%s [%s]", op, strings.Join(syms2, ", "))
+}
+
+func (InvalidMatcher) String() string { return "invalid" }
+
+func (r Rule) String() string { return r.Format(nil) }
+
+// Format renders r as "head <- body1, body2, ... | constraints", e.g.
+// right(#authority, $0, #read) <- resource(#ambient, $0), operation(#ambient, #read).
+func (r Rule) Format(syms *SymbolTable) string {
+	body := make([]string, len(r.Body))
+	for i, p := range r.Body {
+		body[i] = p.Format(syms)
+	}
+	s := fmt.Sprintf("%s <- %s", r.Head.Format(syms), strings.Join(body, ", "))
+	if len(r.Constraints) == 0 {
+		return s
+	}
+	constraints := make([]string, len(r.Constraints))
+	for i, c := range r.Constraints {
+		constraints[i] = c.Format(syms)
+	}
+	return fmt.Sprintf("%s | %s", s, strings.Join(constraints, ", "))
+}
+
+func (c Caveat) String() string { return c.Format(nil) }
+
+// Format renders c as its queries joined with " || ", the way a caveat
+// succeeds if any one of its queries does.
+func (c Caveat) Format(syms *SymbolTable) string {
+	queries := make([]string, len(c.Queries))
+	for i, q := range c.Queries {
+		queries[i] = q.Format(syms)
+	}
+	return strings.Join(queries, " || ")
+}
+
+// Diff renders a and b in the canonical surface syntax and returns a unified
+// diff line of the two, or "" if they render identically. It is meant for
+// use in test failure messages, where it is far more legible than
+// reflect.DeepEqual's default output.
+func Diff(a, b Rule) string {
+	as, bs := a.String(), b.String()
+	if as == bs {
+		return ""
+	}
+	return fmt.Sprintf("- %s\n+ %s", as, bs)
+}
@@ -0,0 +1,50 @@
+package datalog
+
+import "testing"
+
+func TestRuleFormat(t *testing.T) {
+	syms := &SymbolTable{}
+	authority := syms.Insert("authority")
+	ambient := syms.Insert("ambient")
+	read := syms.Insert("read")
+	syms.Insert("right")
+	syms.Insert("resource")
+	syms.Insert("operation")
+
+	right, _ := syms.Sym("right")
+	resource, _ := syms.Sym("resource")
+	operation, _ := syms.Sym("operation")
+
+	r := Rule{
+		Head: Predicate{Name: right, IDs: []ID{authority, Variable(0), read}},
+		Body: []Predicate{
+			{Name: resource, IDs: []ID{ambient, Variable(0)}},
+			{Name: operation, IDs: []ID{ambient, read}},
+		},
+	}
+
+	got := r.Format(syms)
+	want := "right(#authority, $0, #read) <- resource(#ambient, $0), operation(#ambient, #read)"
+	if got != want {
+		t.Errorf("Format() = %q, want %q", got, want)
+	}
+
+	if got := r.String(); got == want {
+		t.Error("String() without a symbol table should not resolve symbol names")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	resource := Predicate{Name: 1, IDs: []ID{Variable(0)}}
+	a := Rule{Head: Predicate{Name: 2, IDs: []ID{Variable(0)}}, Body: []Predicate{resource}}
+	b := Rule{Head: Predicate{Name: 2, IDs: []ID{Variable(0)}}, Body: []Predicate{resource}}
+
+	if diff := Diff(a, b); diff != "" {
+		t.Errorf("expected no diff for identical rules, got: %q", diff)
+	}
+
+	b.Head.IDs[0] = Variable(1)
+	if diff := Diff(a, b); diff == "" {
+		t.Error("expected a diff for rules with different heads")
+	}
+}
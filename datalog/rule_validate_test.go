@@ -0,0 +1,173 @@
+package datalog
+
+import "testing"
+
+func TestRuleValidate(t *testing.T) {
+	resource := Predicate{Name: 1, IDs: []ID{Variable(0)}}
+	right := Predicate{Name: 2, IDs: []ID{Variable(0)}}
+
+	t.Run("valid rule", func(t *testing.T) {
+		r := Rule{Head: right, Body: []Predicate{resource}}
+		if err := r.Validate(); err != nil {
+			t.Errorf("expected no error, got: %v", err)
+		}
+	})
+
+	t.Run("head variable missing from body", func(t *testing.T) {
+		// Head uses $1, which never appears in the body; that also leaves
+		// the body's own $0 unused, so both diagnostics are expected.
+		r := Rule{Head: Predicate{Name: 2, IDs: []ID{Variable(1)}}, Body: []Predicate{resource}}
+		err := r.Validate()
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		verr, ok := err.(*RuleValidationError)
+		if !ok {
+			t.Fatalf("expected *RuleValidationError, got %T", err)
+		}
+		var sawHeadVariable bool
+		for _, d := range verr.Diagnostics {
+			if d.Kind == DiagnosticHeadVariableNotInBody {
+				sawHeadVariable = true
+			}
+		}
+		if !sawHeadVariable {
+			t.Errorf("expected a DiagnosticHeadVariableNotInBody, got: %+v", verr.Diagnostics)
+		}
+	})
+
+	t.Run("constraint variable missing from body", func(t *testing.T) {
+		r := Rule{
+			Head: right,
+			Body: []Predicate{resource},
+			Constraints: []Constraint{
+				{Name: Variable(9), Matcher: &IntegerComparisonMatcher{Comparison: IntegerComparisonEqual, Integer: 1}},
+			},
+		}
+		err := r.Validate()
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		verr := err.(*RuleValidationError)
+		found := false
+		for _, d := range verr.Diagnostics {
+			if d.Kind == DiagnosticConstraintVariableNotInBody {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected a DiagnosticConstraintVariableNotInBody, got: %+v", verr.Diagnostics)
+		}
+	})
+
+	t.Run("unused body variable", func(t *testing.T) {
+		// $1 appears only in the second body predicate, and is never used
+		// by the head or a constraint.
+		r := Rule{
+			Head: right,
+			Body: []Predicate{
+				resource,
+				{Name: 3, IDs: []ID{Variable(0), Variable(1)}},
+			},
+		}
+		err := r.Validate()
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		verr := err.(*RuleValidationError)
+		found := false
+		for _, d := range verr.Diagnostics {
+			if d.Kind == DiagnosticUnusedBodyVariable {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected a DiagnosticUnusedBodyVariable, got: %+v", verr.Diagnostics)
+		}
+	})
+
+	t.Run("different glob patterns are not duplicates", func(t *testing.T) {
+		m1, err := NewStringGlobMatcher("/api/v1/*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		m2, err := NewStringGlobMatcher("/api/v2/*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := Rule{
+			Head: right,
+			Body: []Predicate{resource},
+			Constraints: []Constraint{
+				{Name: Variable(0), Matcher: m1},
+				{Name: Variable(0), Matcher: m2},
+			},
+		}
+		if err := r.Validate(); err != nil {
+			verr := err.(*RuleValidationError)
+			for _, d := range verr.Diagnostics {
+				if d.Kind == DiagnosticDuplicateConstraint {
+					t.Errorf("constraints with different glob patterns wrongly flagged as duplicates: %+v", verr.Diagnostics)
+				}
+			}
+		}
+	})
+
+	t.Run("identical glob patterns are duplicates", func(t *testing.T) {
+		m1, err := NewStringGlobMatcher("/api/v1/*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		m2, err := NewStringGlobMatcher("/api/v1/*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := Rule{
+			Head: right,
+			Body: []Predicate{resource},
+			Constraints: []Constraint{
+				{Name: Variable(0), Matcher: m1},
+				{Name: Variable(0), Matcher: m2},
+			},
+		}
+		err = r.Validate()
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		verr := err.(*RuleValidationError)
+		found := false
+		for _, d := range verr.Diagnostics {
+			if d.Kind == DiagnosticDuplicateConstraint {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected a DiagnosticDuplicateConstraint, got: %+v", verr.Diagnostics)
+		}
+	})
+
+	t.Run("constraint type mismatch", func(t *testing.T) {
+		r := Rule{
+			Head: right,
+			Body: []Predicate{resource},
+			Constraints: []Constraint{
+				{Name: Variable(0), Matcher: &IntegerComparisonMatcher{Comparison: IntegerComparisonEqual, Integer: 1}},
+				{Name: Variable(0), Matcher: &DateComparisonMatcher{Comparison: DateComparisonBefore, Date: 1}},
+			},
+		}
+		err := r.Validate()
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		verr := err.(*RuleValidationError)
+		found := false
+		for _, d := range verr.Diagnostics {
+			if d.Kind == DiagnosticConstraintTypeMismatch {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected a DiagnosticConstraintTypeMismatch, got: %+v", verr.Diagnostics)
+		}
+	})
+}
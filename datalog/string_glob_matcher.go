@@ -0,0 +1,39 @@
+package datalog
+
+import "github.com/gobwas/glob"
+
+// StringGlobMatcher matches String IDs against a shell-style glob pattern
+// (`*`, `?`, `[abc]`, `{a,b}`, and path-separator-aware forms). The pattern
+// is compiled once at construction time into a gobwas/glob automaton, so
+// Match runs in time proportional to the length of the candidate string
+// rather than re-parsing the pattern.
+type StringGlobMatcher struct {
+	pattern string
+	g       glob.Glob
+}
+
+// NewStringGlobMatcher compiles pattern into a StringGlobMatcher. separators,
+// when given, restrict `*` and `?` from crossing those runes, the same way
+// path-aware glob matching keeps `*` from matching across `/`.
+func NewStringGlobMatcher(pattern string, separators ...rune) (*StringGlobMatcher, error) {
+	g, err := glob.Compile(pattern, separators...)
+	if err != nil {
+		return nil, err
+	}
+	return &StringGlobMatcher{pattern: pattern, g: g}, nil
+}
+
+// Pattern returns the glob pattern m was compiled from, so that callers
+// needing to render or re-marshal m (String, Format, the textformat
+// frontend) don't have to reverse-engineer it out of the compiled automaton.
+func (m *StringGlobMatcher) Pattern() string {
+	return m.pattern
+}
+
+func (m *StringGlobMatcher) Match(id ID) bool {
+	s, ok := id.(String)
+	if !ok {
+		return false
+	}
+	return m.g.Match(string(s))
+}
@@ -0,0 +1,67 @@
+package datalog
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestStringGlobMatcher(t *testing.T) {
+	cases := []struct {
+		pattern string
+		input   String
+		match   bool
+	}{
+		{"/api/v1/*", "/api/v1/users", true},
+		{"/api/v1/*", "/api/v2/users", false},
+		{"/api/v?/users", "/api/v1/users", true},
+		{"/api/v[12]/users", "/api/v3/users", false},
+		{"/api/{users,groups}", "/api/groups", true},
+		{"/api/{users,groups}", "/api/teams", false},
+	}
+
+	for _, c := range cases {
+		m, err := NewStringGlobMatcher(c.pattern)
+		if err != nil {
+			t.Fatalf("compile %q: %v", c.pattern, err)
+		}
+		if got := m.Match(c.input); got != c.match {
+			t.Errorf("pattern %q against %q: got %v, want %v", c.pattern, c.input, got, c.match)
+		}
+	}
+
+	if (&StringGlobMatcher{}).Match(Integer(42)) {
+		t.Error("expected non-String ID to never match")
+	}
+}
+
+func TestStringGlobMatcherPattern(t *testing.T) {
+	m, err := NewStringGlobMatcher("/api/v1/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.Pattern(), "/api/v1/*"; got != want {
+		t.Errorf("Pattern() = %q, want %q", got, want)
+	}
+}
+
+func BenchmarkStringGlobMatcher(b *testing.B) {
+	m, err := NewStringGlobMatcher("/api/v1/*")
+	if err != nil {
+		b.Fatal(err)
+	}
+	s := String("/api/v1/users/42/profile")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Match(s)
+	}
+}
+
+func BenchmarkStringRegexpMatcher(b *testing.B) {
+	re := regexp.MustCompile(`^/api/v1/.*$`)
+	m := (*StringRegexpMatcher)(re)
+	s := String("/api/v1/users/42/profile")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Match(s)
+	}
+}
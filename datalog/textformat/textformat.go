@@ -0,0 +1,518 @@
+// Package textformat lets datalog Rule, Predicate, Fact and Caveat values be
+// authored as JSON (or, via ghodss/yaml, as YAML) instead of constructed by
+// hand in Go. It targets a single canonical schema so that operators can
+// commit human-readable policy files to version control and have CI compile
+// them into biscuit tokens.
+//
+// The biscuit wire format itself is a protobuf message produced elsewhere in
+// this module; this package only covers the datalog value objects
+// (datalog.Rule, datalog.Predicate, datalog.Fact, datalog.Caveat) that those
+// protobuf messages are built from, round-tripping through them. Two things
+// do not survive a round trip: a StringGlobMatcher's separator runes are not
+// encoded, so it decodes as compiled without separators; and an empty
+// integer, string or symbol in-set is omitted on encoding, so the encoded
+// matcher fails to decode.
+package textformat
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/fimbault/biscuit-go/datalog"
+)
+
+// PathError reports a problem found while decoding a JSON document, together
+// with the JSON path at which it occurred (e.g. "body[1].ids[0]"), so
+// authoring mistakes in a policy file can be pointed at directly.
+type PathError struct {
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("textformat: %s: %v", e.Path, e.Err)
+}
+
+func (e *PathError) Unwrap() error { return e.Err }
+
+func pathErrorf(path, format string, args ...interface{}) *PathError {
+	return &PathError{Path: path, Err: fmt.Errorf(format, args...)}
+}
+
+// jsonID is the canonical JSON encoding of a datalog.ID: exactly one field
+// is set, naming which ID variant it represents.
+type jsonID struct {
+	Symbol   *string `json:"symbol,omitempty"`
+	Variable *uint32 `json:"variable,omitempty"`
+	Integer  *int64  `json:"integer,omitempty"`
+	String   *string `json:"string,omitempty"`
+	Date     *string `json:"date,omitempty"` // RFC 3339
+}
+
+func idFromJSON(j jsonID, syms *datalog.SymbolTable, path string) (datalog.ID, error) {
+	switch {
+	case j.Symbol != nil:
+		return syms.Insert(*j.Symbol), nil
+	case j.Variable != nil:
+		return datalog.Variable(*j.Variable), nil
+	case j.Integer != nil:
+		return datalog.Integer(*j.Integer), nil
+	case j.String != nil:
+		return datalog.String(*j.String), nil
+	case j.Date != nil:
+		t, err := time.Parse(time.RFC3339, *j.Date)
+		if err != nil {
+			return nil, pathErrorf(path, "invalid date %q: %w", *j.Date, err)
+		}
+		return datalog.Date(t.Unix()), nil
+	default:
+		return nil, pathErrorf(path, "id has no symbol, variable, integer, string or date set")
+	}
+}
+
+func idToJSON(id datalog.ID, syms *datalog.SymbolTable, path string) (jsonID, error) {
+	switch v := id.(type) {
+	case datalog.Symbol:
+		name, ok := syms.Str(v)
+		if !ok {
+			return jsonID{}, pathErrorf(path, "symbol %d not present in symbol table", v)
+		}
+		return jsonID{Symbol: &name}, nil
+	case datalog.Variable:
+		n := uint32(v)
+		return jsonID{Variable: &n}, nil
+	case datalog.Integer:
+		n := int64(v)
+		return jsonID{Integer: &n}, nil
+	case datalog.String:
+		s := string(v)
+		return jsonID{String: &s}, nil
+	case datalog.Date:
+		s := time.Unix(int64(v), 0).UTC().Format(time.RFC3339)
+		return jsonID{Date: &s}, nil
+	default:
+		return jsonID{}, pathErrorf(path, "unsupported id type %T", id)
+	}
+}
+
+type jsonPredicate struct {
+	Name string   `json:"name"`
+	IDs  []jsonID `json:"ids"`
+}
+
+func predicateFromJSON(j jsonPredicate, syms *datalog.SymbolTable, path string) (datalog.Predicate, error) {
+	if j.Name == "" {
+		return datalog.Predicate{}, pathErrorf(path+".name", "predicate name is required")
+	}
+	ids := make([]datalog.ID, len(j.IDs))
+	for i, jid := range j.IDs {
+		id, err := idFromJSON(jid, syms, fmt.Sprintf("%s.ids[%d]", path, i))
+		if err != nil {
+			return datalog.Predicate{}, err
+		}
+		ids[i] = id
+	}
+	return datalog.Predicate{Name: syms.Insert(j.Name), IDs: ids}, nil
+}
+
+func predicateToJSON(p datalog.Predicate, syms *datalog.SymbolTable, path string) (jsonPredicate, error) {
+	name, ok := syms.Str(p.Name)
+	if !ok {
+		return jsonPredicate{}, pathErrorf(path+".name", "symbol %d not present in symbol table", p.Name)
+	}
+	ids := make([]jsonID, len(p.IDs))
+	for i, id := range p.IDs {
+		jid, err := idToJSON(id, syms, fmt.Sprintf("%s.ids[%d]", path, i))
+		if err != nil {
+			return jsonPredicate{}, err
+		}
+		ids[i] = jid
+	}
+	return jsonPredicate{Name: name, IDs: ids}, nil
+}
+
+// jsonMatcher is the canonical JSON encoding of a datalog.Matcher: exactly
+// one field is set, naming which Matcher implementation it represents.
+type jsonMatcher struct {
+	IntegerEqual *int64  `json:"integer_equal,omitempty"`
+	IntegerLT    *int64  `json:"integer_lt,omitempty"`
+	IntegerGT    *int64  `json:"integer_gt,omitempty"`
+	IntegerLTE   *int64  `json:"integer_lte,omitempty"`
+	IntegerGTE   *int64  `json:"integer_gte,omitempty"`
+	IntegerIn    []int64 `json:"integer_in,omitempty"`
+	IntegerNotIn []int64 `json:"integer_not_in,omitempty"`
+
+	StringEqual  *string  `json:"string_equal,omitempty"`
+	StringPrefix *string  `json:"string_prefix,omitempty"`
+	StringSuffix *string  `json:"string_suffix,omitempty"`
+	StringIn     []string `json:"string_in,omitempty"`
+	StringNotIn  []string `json:"string_not_in,omitempty"`
+	StringRegexp *string  `json:"string_regexp,omitempty"`
+	StringGlob   *string  `json:"string_glob,omitempty"`
+
+	SymbolIn    []string `json:"symbol_in,omitempty"`
+	SymbolNotIn []string `json:"symbol_not_in,omitempty"`
+
+	DateBefore *string `json:"date_before,omitempty"`
+	DateAfter  *string `json:"date_after,omitempty"`
+}
+
+func matcherFromJSON(j jsonMatcher, syms *datalog.SymbolTable, path string) (datalog.Matcher, error) {
+	switch {
+	case j.IntegerEqual != nil:
+		return &datalog.IntegerComparisonMatcher{Comparison: datalog.IntegerComparisonEqual, Integer: datalog.Integer(*j.IntegerEqual)}, nil
+	case j.IntegerLT != nil:
+		return &datalog.IntegerComparisonMatcher{Comparison: datalog.IntegerComparisonLT, Integer: datalog.Integer(*j.IntegerLT)}, nil
+	case j.IntegerGT != nil:
+		return &datalog.IntegerComparisonMatcher{Comparison: datalog.IntegerComparisonGT, Integer: datalog.Integer(*j.IntegerGT)}, nil
+	case j.IntegerLTE != nil:
+		return &datalog.IntegerComparisonMatcher{Comparison: datalog.IntegerComparisonLTE, Integer: datalog.Integer(*j.IntegerLTE)}, nil
+	case j.IntegerGTE != nil:
+		return &datalog.IntegerComparisonMatcher{Comparison: datalog.IntegerComparisonGTE, Integer: datalog.Integer(*j.IntegerGTE)}, nil
+	case j.IntegerIn != nil:
+		return &datalog.IntegerInMatcher{Set: integerSet(j.IntegerIn)}, nil
+	case j.IntegerNotIn != nil:
+		return &datalog.IntegerInMatcher{Set: integerSet(j.IntegerNotIn), Not: true}, nil
+	case j.StringEqual != nil:
+		return &datalog.StringComparisonMatcher{Comparison: datalog.StringComparisonEqual, Str: datalog.String(*j.StringEqual)}, nil
+	case j.StringPrefix != nil:
+		return &datalog.StringComparisonMatcher{Comparison: datalog.StringComparisonPrefix, Str: datalog.String(*j.StringPrefix)}, nil
+	case j.StringSuffix != nil:
+		return &datalog.StringComparisonMatcher{Comparison: datalog.StringComparisonSuffix, Str: datalog.String(*j.StringSuffix)}, nil
+	case j.StringIn != nil:
+		return &datalog.StringInMatcher{Set: stringSet(j.StringIn)}, nil
+	case j.StringNotIn != nil:
+		return &datalog.StringInMatcher{Set: stringSet(j.StringNotIn), Not: true}, nil
+	case j.StringRegexp != nil:
+		m, err := regexpMatcher(*j.StringRegexp)
+		if err != nil {
+			return nil, pathErrorf(path, "invalid regexp %q: %w", *j.StringRegexp, err)
+		}
+		return m, nil
+	case j.StringGlob != nil:
+		m, err := datalog.NewStringGlobMatcher(*j.StringGlob)
+		if err != nil {
+			return nil, pathErrorf(path, "invalid glob %q: %w", *j.StringGlob, err)
+		}
+		return m, nil
+	case j.SymbolIn != nil:
+		return &datalog.SymbolInMatcher{Set: symbolSet(syms, j.SymbolIn)}, nil
+	case j.SymbolNotIn != nil:
+		return &datalog.SymbolInMatcher{Set: symbolSet(syms, j.SymbolNotIn), Not: true}, nil
+	case j.DateBefore != nil:
+		t, err := time.Parse(time.RFC3339, *j.DateBefore)
+		if err != nil {
+			return nil, pathErrorf(path, "invalid date %q: %w", *j.DateBefore, err)
+		}
+		return &datalog.DateComparisonMatcher{Comparison: datalog.DateComparisonBefore, Date: datalog.Date(t.Unix())}, nil
+	case j.DateAfter != nil:
+		t, err := time.Parse(time.RFC3339, *j.DateAfter)
+		if err != nil {
+			return nil, pathErrorf(path, "invalid date %q: %w", *j.DateAfter, err)
+		}
+		return &datalog.DateComparisonMatcher{Comparison: datalog.DateComparisonAfter, Date: datalog.Date(t.Unix())}, nil
+	default:
+		return nil, pathErrorf(path, "matcher has no recognized field set")
+	}
+}
+
+func matcherToJSON(m datalog.Matcher, syms *datalog.SymbolTable, path string) (jsonMatcher, error) {
+	switch v := m.(type) {
+	case *datalog.IntegerComparisonMatcher:
+		n := int64(v.Integer)
+		switch v.Comparison {
+		case datalog.IntegerComparisonEqual:
+			return jsonMatcher{IntegerEqual: &n}, nil
+		case datalog.IntegerComparisonLT:
+			return jsonMatcher{IntegerLT: &n}, nil
+		case datalog.IntegerComparisonGT:
+			return jsonMatcher{IntegerGT: &n}, nil
+		case datalog.IntegerComparisonLTE:
+			return jsonMatcher{IntegerLTE: &n}, nil
+		case datalog.IntegerComparisonGTE:
+			return jsonMatcher{IntegerGTE: &n}, nil
+		}
+	case *datalog.IntegerInMatcher:
+		ints := integerSlice(v.Set)
+		if v.Not {
+			return jsonMatcher{IntegerNotIn: ints}, nil
+		}
+		return jsonMatcher{IntegerIn: ints}, nil
+	case *datalog.StringComparisonMatcher:
+		s := string(v.Str)
+		switch v.Comparison {
+		case datalog.StringComparisonEqual:
+			return jsonMatcher{StringEqual: &s}, nil
+		case datalog.StringComparisonPrefix:
+			return jsonMatcher{StringPrefix: &s}, nil
+		case datalog.StringComparisonSuffix:
+			return jsonMatcher{StringSuffix: &s}, nil
+		}
+	case *datalog.StringInMatcher:
+		strs := stringSlice(v.Set)
+		if v.Not {
+			return jsonMatcher{StringNotIn: strs}, nil
+		}
+		return jsonMatcher{StringIn: strs}, nil
+	case *datalog.StringRegexpMatcher:
+		s := regexpString(v)
+		return jsonMatcher{StringRegexp: &s}, nil
+	case *datalog.StringGlobMatcher:
+		s := v.Pattern()
+		return jsonMatcher{StringGlob: &s}, nil
+	case *datalog.SymbolInMatcher:
+		syms2, err := symbolSlice(syms, v.Set, path)
+		if err != nil {
+			return jsonMatcher{}, err
+		}
+		if v.Not {
+			return jsonMatcher{SymbolNotIn: syms2}, nil
+		}
+		return jsonMatcher{SymbolIn: syms2}, nil
+	case *datalog.DateComparisonMatcher:
+		s := time.Unix(int64(v.Date), 0).UTC().Format(time.RFC3339)
+		switch v.Comparison {
+		case datalog.DateComparisonBefore:
+			return jsonMatcher{DateBefore: &s}, nil
+		case datalog.DateComparisonAfter:
+			return jsonMatcher{DateAfter: &s}, nil
+		}
+	}
+	return jsonMatcher{}, pathErrorf(path, "unsupported matcher type %T", m)
+}
+
+type jsonConstraint struct {
+	Variable uint32      `json:"variable"`
+	Matcher  jsonMatcher `json:"matcher"`
+}
+
+type jsonRule struct {
+	Head        jsonPredicate    `json:"head"`
+	Body        []jsonPredicate  `json:"body"`
+	Constraints []jsonConstraint `json:"constraints,omitempty"`
+}
+
+// UnmarshalRule decodes a JSON-encoded rule into a datalog.Rule, interning
+// any symbol names it encounters into syms.
+func UnmarshalRule(data []byte, syms *datalog.SymbolTable) (datalog.Rule, error) {
+	var j jsonRule
+	if err := json.Unmarshal(data, &j); err != nil {
+		return datalog.Rule{}, &PathError{Path: "$", Err: err}
+	}
+
+	head, err := predicateFromJSON(j.Head, syms, "$.head")
+	if err != nil {
+		return datalog.Rule{}, err
+	}
+
+	body := make([]datalog.Predicate, len(j.Body))
+	for i, jp := range j.Body {
+		p, err := predicateFromJSON(jp, syms, fmt.Sprintf("$.body[%d]", i))
+		if err != nil {
+			return datalog.Rule{}, err
+		}
+		body[i] = p
+	}
+
+	constraints := make([]datalog.Constraint, len(j.Constraints))
+	for i, jc := range j.Constraints {
+		path := fmt.Sprintf("$.constraints[%d]", i)
+		m, err := matcherFromJSON(jc.Matcher, syms, path+".matcher")
+		if err != nil {
+			return datalog.Rule{}, err
+		}
+		constraints[i] = datalog.Constraint{Name: datalog.Variable(jc.Variable), Matcher: m}
+	}
+
+	rule := datalog.Rule{Head: head, Body: body, Constraints: constraints}
+	if err := rule.Validate(); err != nil {
+		return datalog.Rule{}, err
+	}
+	return rule, nil
+}
+
+// MarshalRule encodes r as JSON, resolving its symbols through syms.
+func MarshalRule(r datalog.Rule, syms *datalog.SymbolTable) ([]byte, error) {
+	head, err := predicateToJSON(r.Head, syms, "$.head")
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]jsonPredicate, len(r.Body))
+	for i, p := range r.Body {
+		jp, err := predicateToJSON(p, syms, fmt.Sprintf("$.body[%d]", i))
+		if err != nil {
+			return nil, err
+		}
+		body[i] = jp
+	}
+
+	constraints := make([]jsonConstraint, len(r.Constraints))
+	for i, c := range r.Constraints {
+		path := fmt.Sprintf("$.constraints[%d]", i)
+		jm, err := matcherToJSON(c.Matcher, syms, path+".matcher")
+		if err != nil {
+			return nil, err
+		}
+		constraints[i] = jsonConstraint{Variable: uint32(c.Name), Matcher: jm}
+	}
+
+	return json.Marshal(jsonRule{Head: head, Body: body, Constraints: constraints})
+}
+
+// UnmarshalPredicate decodes a JSON-encoded predicate into a datalog.Predicate.
+func UnmarshalPredicate(data []byte, syms *datalog.SymbolTable) (datalog.Predicate, error) {
+	var j jsonPredicate
+	if err := json.Unmarshal(data, &j); err != nil {
+		return datalog.Predicate{}, &PathError{Path: "$", Err: err}
+	}
+	return predicateFromJSON(j, syms, "$")
+}
+
+// MarshalPredicate encodes p as JSON, resolving its symbols through syms.
+func MarshalPredicate(p datalog.Predicate, syms *datalog.SymbolTable) ([]byte, error) {
+	j, err := predicateToJSON(p, syms, "$")
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(j)
+}
+
+type jsonFact struct {
+	jsonPredicate
+}
+
+// UnmarshalFact decodes a JSON-encoded fact into a datalog.Fact.
+func UnmarshalFact(data []byte, syms *datalog.SymbolTable) (datalog.Fact, error) {
+	var j jsonFact
+	if err := json.Unmarshal(data, &j); err != nil {
+		return datalog.Fact{}, &PathError{Path: "$", Err: err}
+	}
+	p, err := predicateFromJSON(j.jsonPredicate, syms, "$")
+	if err != nil {
+		return datalog.Fact{}, err
+	}
+	return datalog.Fact{Predicate: p}, nil
+}
+
+// MarshalFact encodes f as JSON, resolving its symbols through syms.
+func MarshalFact(f datalog.Fact, syms *datalog.SymbolTable) ([]byte, error) {
+	j, err := predicateToJSON(f.Predicate, syms, "$")
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonFact{jsonPredicate: j})
+}
+
+type jsonCaveat struct {
+	Queries []jsonRule `json:"queries"`
+}
+
+// UnmarshalCaveat decodes a JSON-encoded caveat into a datalog.Caveat.
+func UnmarshalCaveat(data []byte, syms *datalog.SymbolTable) (datalog.Caveat, error) {
+	var j jsonCaveat
+	if err := json.Unmarshal(data, &j); err != nil {
+		return datalog.Caveat{}, &PathError{Path: "$", Err: err}
+	}
+
+	queries := make([]datalog.Rule, len(j.Queries))
+	for i, jr := range j.Queries {
+		b, err := json.Marshal(jr)
+		if err != nil {
+			return datalog.Caveat{}, &PathError{Path: fmt.Sprintf("$.queries[%d]", i), Err: err}
+		}
+		r, err := UnmarshalRule(b, syms)
+		if err != nil {
+			if pe, ok := err.(*PathError); ok {
+				pe.Path = fmt.Sprintf("$.queries[%d]%s", i, pe.Path[1:])
+			}
+			return datalog.Caveat{}, err
+		}
+		queries[i] = r
+	}
+
+	return datalog.Caveat{Queries: queries}, nil
+}
+
+// MarshalCaveat encodes c as JSON, resolving its symbols through syms.
+func MarshalCaveat(c datalog.Caveat, syms *datalog.SymbolTable) ([]byte, error) {
+	queries := make([]jsonRule, len(c.Queries))
+	for i, r := range c.Queries {
+		b, err := MarshalRule(r, syms)
+		if err != nil {
+			return nil, err
+		}
+		var jr jsonRule
+		if err := json.Unmarshal(b, &jr); err != nil {
+			return nil, &PathError{Path: fmt.Sprintf("$.queries[%d]", i), Err: err}
+		}
+		queries[i] = jr
+	}
+	return json.Marshal(jsonCaveat{Queries: queries})
+}
+
+func regexpMatcher(pattern string) (*datalog.StringRegexpMatcher, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return (*datalog.StringRegexpMatcher)(re), nil
+}
+
+func regexpString(m *datalog.StringRegexpMatcher) string {
+	return (*regexp.Regexp)(m).String()
+}
+
+func integerSet(in []int64) map[datalog.Integer]struct{} {
+	set := make(map[datalog.Integer]struct{}, len(in))
+	for _, v := range in {
+		set[datalog.Integer(v)] = struct{}{}
+	}
+	return set
+}
+
+func integerSlice(set map[datalog.Integer]struct{}) []int64 {
+	out := make([]int64, 0, len(set))
+	for v := range set {
+		out = append(out, int64(v))
+	}
+	return out
+}
+
+func stringSet(in []string) map[datalog.String]struct{} {
+	set := make(map[datalog.String]struct{}, len(in))
+	for _, v := range in {
+		set[datalog.String(v)] = struct{}{}
+	}
+	return set
+}
+
+func stringSlice(set map[datalog.String]struct{}) []string {
+	out := make([]string, 0, len(set))
+	for v := range set {
+		out = append(out, string(v))
+	}
+	return out
+}
+
+func symbolSet(syms *datalog.SymbolTable, in []string) map[datalog.Symbol]struct{} {
+	set := make(map[datalog.Symbol]struct{}, len(in))
+	for _, v := range in {
+		set[syms.Insert(v)] = struct{}{}
+	}
+	return set
+}
+
+func symbolSlice(syms *datalog.SymbolTable, set map[datalog.Symbol]struct{}, path string) ([]string, error) {
+	out := make([]string, 0, len(set))
+	for s := range set {
+		name, ok := syms.Str(s)
+		if !ok {
+			return nil, pathErrorf(path, "symbol %d not present in symbol table", s)
+		}
+		out = append(out, name)
+	}
+	return out, nil
+}
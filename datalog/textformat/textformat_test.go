@@ -0,0 +1,149 @@
+package textformat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fimbault/biscuit-go/datalog"
+)
+
+func TestRuleRoundTrip(t *testing.T) {
+	input := []byte(`{
+		"head": {"name": "right", "ids": [{"symbol": "authority"}, {"variable": 0}, {"symbol": "read"}]},
+		"body": [
+			{"name": "resource", "ids": [{"symbol": "ambient"}, {"variable": 0}]},
+			{"name": "operation", "ids": [{"symbol": "ambient"}, {"symbol": "read"}]}
+		],
+		"constraints": [
+			{"variable": 0, "matcher": {"string_regexp": "^/api/v1/.*$"}}
+		]
+	}`)
+
+	syms := &datalog.SymbolTable{}
+	rule, err := UnmarshalRule(input, syms)
+	if err != nil {
+		t.Fatalf("UnmarshalRule: %v", err)
+	}
+
+	if len(rule.Body) != 2 {
+		t.Fatalf("expected 2 body predicates, got %d", len(rule.Body))
+	}
+	if len(rule.Constraints) != 1 {
+		t.Fatalf("expected 1 constraint, got %d", len(rule.Constraints))
+	}
+	if !rule.Constraints[0].Match(datalog.String("/api/v1/users")) {
+		t.Error("expected regexp constraint to match /api/v1/users")
+	}
+
+	out, err := MarshalRule(rule, syms)
+	if err != nil {
+		t.Fatalf("MarshalRule: %v", err)
+	}
+	rule2, err := UnmarshalRule(out, syms)
+	if err != nil {
+		t.Fatalf("re-UnmarshalRule: %v", err)
+	}
+	if !rule.Head.Equal(rule2.Head) {
+		t.Errorf("round-tripped head differs: %+v vs %+v", rule.Head, rule2.Head)
+	}
+}
+
+func TestMarshalRuleGlobConstraintRoundTrip(t *testing.T) {
+	input := []byte(`{
+		"head": {"name": "right", "ids": [{"variable": 0}]},
+		"body": [{"name": "resource", "ids": [{"variable": 0}]}],
+		"constraints": [{"variable": 0, "matcher": {"string_glob": "/api/v1/*"}}]
+	}`)
+
+	syms := &datalog.SymbolTable{}
+	rule, err := UnmarshalRule(input, syms)
+	if err != nil {
+		t.Fatalf("UnmarshalRule: %v", err)
+	}
+	if !rule.Constraints[0].Match(datalog.String("/api/v1/users")) {
+		t.Error("expected glob constraint to match /api/v1/users")
+	}
+
+	out, err := MarshalRule(rule, syms)
+	if err != nil {
+		t.Fatalf("MarshalRule: %v", err)
+	}
+	rule2, err := UnmarshalRule(out, syms)
+	if err != nil {
+		t.Fatalf("re-UnmarshalRule: %v", err)
+	}
+	if !rule2.Constraints[0].Match(datalog.String("/api/v1/users")) {
+		t.Error("round-tripped glob constraint no longer matches /api/v1/users")
+	}
+	if rule2.Constraints[0].Match(datalog.String("/api/v2/users")) {
+		t.Error("round-tripped glob constraint should not match /api/v2/users")
+	}
+}
+
+func TestMarshalRuleSymbolInConstraintRoundTrip(t *testing.T) {
+	input := []byte(`{
+		"head": {"name": "right", "ids": [{"variable": 0}]},
+		"body": [{"name": "resource", "ids": [{"variable": 0}]}],
+		"constraints": [{"variable": 0, "matcher": {"symbol_in": ["authority", "ambient"]}}]
+	}`)
+
+	syms := &datalog.SymbolTable{}
+	rule, err := UnmarshalRule(input, syms)
+	if err != nil {
+		t.Fatalf("UnmarshalRule: %v", err)
+	}
+	if !rule.Constraints[0].Match(syms.Insert("authority")) {
+		t.Error("expected symbol_in constraint to match #authority")
+	}
+	if rule.Constraints[0].Match(syms.Insert("read")) {
+		t.Error("expected symbol_in constraint not to match #read")
+	}
+
+	out, err := MarshalRule(rule, syms)
+	if err != nil {
+		t.Fatalf("MarshalRule: %v", err)
+	}
+	rule2, err := UnmarshalRule(out, syms)
+	if err != nil {
+		t.Fatalf("re-UnmarshalRule: %v", err)
+	}
+	if !rule2.Constraints[0].Match(syms.Insert("authority")) {
+		t.Error("round-tripped symbol_in constraint no longer matches #authority")
+	}
+	if rule2.Constraints[0].Match(syms.Insert("read")) {
+		t.Error("round-tripped symbol_in constraint should not match #read")
+	}
+}
+
+func TestUnmarshalRuleMissingPredicateName(t *testing.T) {
+	input := []byte(`{"head": {"name": "", "ids": []}, "body": []}`)
+	_, err := UnmarshalRule(input, &datalog.SymbolTable{})
+	if err == nil {
+		t.Fatal("expected an error for a missing predicate name")
+	}
+	if !strings.Contains(err.Error(), "$.head.name") {
+		t.Errorf("expected error to point at $.head.name, got: %v", err)
+	}
+}
+
+func TestFactYAMLRoundTrip(t *testing.T) {
+	input := []byte("name: resource\nids:\n  - symbol: ambient\n  - string: /api/v1/users\n")
+	syms := &datalog.SymbolTable{}
+
+	fact, err := UnmarshalFactYAML(input, syms)
+	if err != nil {
+		t.Fatalf("UnmarshalFactYAML: %v", err)
+	}
+
+	out, err := MarshalFactYAML(fact, syms)
+	if err != nil {
+		t.Fatalf("MarshalFactYAML: %v", err)
+	}
+	fact2, err := UnmarshalFactYAML(out, syms)
+	if err != nil {
+		t.Fatalf("re-UnmarshalFactYAML: %v", err)
+	}
+	if !fact.Equal(fact2.Predicate) {
+		t.Errorf("round-tripped fact differs: %+v vs %+v", fact, fact2)
+	}
+}
@@ -0,0 +1,65 @@
+package textformat
+
+import (
+	"github.com/ghodss/yaml"
+
+	"github.com/fimbault/biscuit-go/datalog"
+)
+
+// UnmarshalRuleYAML decodes a YAML-encoded rule the same way UnmarshalRule
+// decodes JSON, converting through ghodss/yaml first so the same jsonRule
+// schema handles both formats.
+func UnmarshalRuleYAML(data []byte, syms *datalog.SymbolTable) (datalog.Rule, error) {
+	j, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return datalog.Rule{}, &PathError{Path: "$", Err: err}
+	}
+	return UnmarshalRule(j, syms)
+}
+
+// MarshalRuleYAML encodes r as YAML, resolving its symbols through syms.
+func MarshalRuleYAML(r datalog.Rule, syms *datalog.SymbolTable) ([]byte, error) {
+	j, err := MarshalRule(r, syms)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.JSONToYAML(j)
+}
+
+// UnmarshalFactYAML decodes a YAML-encoded fact the same way UnmarshalFact
+// decodes JSON.
+func UnmarshalFactYAML(data []byte, syms *datalog.SymbolTable) (datalog.Fact, error) {
+	j, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return datalog.Fact{}, &PathError{Path: "$", Err: err}
+	}
+	return UnmarshalFact(j, syms)
+}
+
+// MarshalFactYAML encodes f as YAML, resolving its symbols through syms.
+func MarshalFactYAML(f datalog.Fact, syms *datalog.SymbolTable) ([]byte, error) {
+	j, err := MarshalFact(f, syms)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.JSONToYAML(j)
+}
+
+// UnmarshalCaveatYAML decodes a YAML-encoded caveat the same way
+// UnmarshalCaveat decodes JSON.
+func UnmarshalCaveatYAML(data []byte, syms *datalog.SymbolTable) (datalog.Caveat, error) {
+	j, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return datalog.Caveat{}, &PathError{Path: "$", Err: err}
+	}
+	return UnmarshalCaveat(j, syms)
+}
+
+// MarshalCaveatYAML encodes c as YAML, resolving its symbols through syms.
+func MarshalCaveatYAML(c datalog.Caveat, syms *datalog.SymbolTable) ([]byte, error) {
+	j, err := MarshalCaveat(c, syms)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.JSONToYAML(j)
+}
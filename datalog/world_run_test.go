@@ -0,0 +1,87 @@
+package datalog
+
+import "testing"
+
+// edgeFact and pathFact build the facts used by the transitive-closure
+// tests below: edge(from, to) and path(from, to), where predicate name 1 is
+// "edge" and 2 is "path".
+func edgeFact(from, to Integer) Fact {
+	return Fact{Predicate{Name: 1, IDs: []ID{from, to}}}
+}
+
+func pathFact(from, to Integer) Fact {
+	return Fact{Predicate{Name: 2, IDs: []ID{from, to}}}
+}
+
+// transitiveClosureWorld returns a World with the two rules needed to
+// compute the transitive closure of an "edge" relation into a "path"
+// relation: path(X, Y) <- edge(X, Y), and path(X, Z) <- path(X, Y), edge(Y, Z).
+func transitiveClosureWorld() *World {
+	w := &World{facts: &FactSet{}}
+	w.AddRule(Rule{
+		Head: Predicate{Name: 2, IDs: []ID{Variable(0), Variable(1)}},
+		Body: []Predicate{
+			{Name: 1, IDs: []ID{Variable(0), Variable(1)}},
+		},
+	})
+	w.AddRule(Rule{
+		Head: Predicate{Name: 2, IDs: []ID{Variable(0), Variable(2)}},
+		Body: []Predicate{
+			{Name: 2, IDs: []ID{Variable(0), Variable(1)}},
+			{Name: 1, IDs: []ID{Variable(1), Variable(2)}},
+		},
+	})
+	return w
+}
+
+func TestWorldRunTransitiveClosure(t *testing.T) {
+	w := transitiveClosureWorld()
+	w.AddFact(edgeFact(1, 2))
+	w.AddFact(edgeFact(2, 3))
+	w.AddFact(edgeFact(3, 4))
+
+	if err := w.Run(); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	want := []Fact{
+		pathFact(1, 2), pathFact(2, 3), pathFact(3, 4),
+		pathFact(1, 3), pathFact(2, 4),
+		pathFact(1, 4),
+	}
+	for _, f := range want {
+		res := w.Query(f.Predicate)
+		if res.Len() != 1 {
+			t.Errorf("expected %s to be derived, got %d matches", f.Predicate.Format(nil), res.Len())
+		}
+	}
+}
+
+// TestWorldRunTwiceAfterAddFact is a regression test: calling Run a second
+// time after AddFact must pick up derivations involving the newly added
+// fact, not just the ones already known at the first Run.
+func TestWorldRunTwiceAfterAddFact(t *testing.T) {
+	w := transitiveClosureWorld()
+	w.AddFact(edgeFact(1, 2))
+	w.AddFact(edgeFact(2, 3))
+
+	if err := w.Run(); err != nil {
+		t.Fatalf("first Run: %v", err)
+	}
+	if res := w.Query(pathFact(1, 3).Predicate); res.Len() != 1 {
+		t.Fatalf("expected path(1, 3) after first Run, got %d matches", res.Len())
+	}
+
+	w.AddFact(edgeFact(3, 4))
+	if err := w.Run(); err != nil {
+		t.Fatalf("second Run: %v", err)
+	}
+
+	want := []Fact{pathFact(3, 4), pathFact(2, 4), pathFact(1, 4)}
+	for _, f := range want {
+		res := w.Query(f.Predicate)
+		if res.Len() != 1 {
+			t.Errorf("expected %s to be derived after second Run, got %d matches", f.Predicate.Format(nil), res.Len())
+		}
+	}
+}